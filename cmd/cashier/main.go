@@ -0,0 +1,115 @@
+// Command cashier requests a signed SSH certificate from a cashier server.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+)
+
+var (
+	serverURL         = flag.String("server", "", "cashier server URL")
+	serviceAccountKey = flag.String("service-account-key", "", "path to a service-account JSON key; when set, authenticates non-interactively through the server's /auth/sa endpoint")
+	bootstrapToken    = flag.String("bootstrap-token", os.Getenv("CASHIER_BOOTSTRAP_TOKEN"), "pre-shared bootstrap token for --service-account-key auth")
+	sshPublicKey      = flag.String("ssh-public-key", defaultSSHPublicKeyPath(), "path to the SSH public key to certify")
+)
+
+func defaultSSHPublicKeyPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return home + "/.ssh/id_rsa.pub"
+}
+
+func main() {
+	flag.Parse()
+
+	if *serviceAccountKey != "" {
+		if err := authenticateServiceAccount(*serverURL, *bootstrapToken, *serviceAccountKey, *sshPublicKey); err != nil {
+			log.Fatalf("service account authentication failed: %v", err)
+		}
+		return
+	}
+
+	// Without --service-account-key this command does nothing; it has no
+	// interactive, browser-based login flow.
+}
+
+// serviceAccountResponse is the body returned by a successful /auth/sa
+// request.
+type serviceAccountResponse struct {
+	Certificate string `json:"certificate"`
+}
+
+// authenticateServiceAccount drives the headless /auth/sa flow: it reads the
+// service-account key from keyPath and the public key to certify from
+// pubKeyPath, posts them to the server, and writes the resulting certificate
+// to disk alongside the public key.
+func authenticateServiceAccount(server, token, keyPath, pubKeyPath string) error {
+	key, err := os.ReadFile(keyPath)
+	if err != nil {
+		return fmt.Errorf("unable to read service account key: %v", err)
+	}
+	pubKey, err := os.ReadFile(pubKeyPath)
+	if err != nil {
+		return fmt.Errorf("unable to read ssh public key: %v", err)
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		return fmt.Errorf("unable to determine hostname: %v", err)
+	}
+
+	body, err := json.Marshal(struct {
+		ID          string `json:"id"`
+		Credentials []byte `json:"credentials"`
+		PublicKey   string `json:"public_key"`
+	}{
+		ID:          "cli-" + hostname,
+		Credentials: key,
+		PublicKey:   string(pubKey),
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, server+"/auth/sa", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Cashier-Bootstrap-Token", token)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("server returned %s: %s", resp.Status, respBody)
+	}
+
+	var sar serviceAccountResponse
+	if err := json.Unmarshal(respBody, &sar); err != nil {
+		return fmt.Errorf("unable to parse server response: %v", err)
+	}
+
+	certPath := strings.TrimSuffix(pubKeyPath, ".pub") + "-cert.pub"
+	if err := os.WriteFile(certPath, []byte(sar.Certificate), 0644); err != nil {
+		return fmt.Errorf("unable to write certificate: %v", err)
+	}
+	fmt.Printf("wrote certificate to %s\n", certPath)
+	return nil
+}
@@ -0,0 +1,76 @@
+// Package auth defines the interface implemented by each authentication
+// backend and the factory used to construct one from configuration.
+package auth
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/cashier-go/cashier/server/auth/bitbucket"
+	"github.com/cashier-go/cashier/server/auth/github"
+	"github.com/cashier-go/cashier/server/auth/gitlab"
+	"github.com/cashier-go/cashier/server/auth/google"
+	"github.com/cashier-go/cashier/server/config"
+
+	"golang.org/x/oauth2"
+)
+
+// Provider is the interface that every authentication backend implements.
+type Provider interface {
+	// Name returns the name of the provider.
+	Name() string
+	// Valid validates the oauth token.
+	Valid(ctx context.Context, token *oauth2.Token) bool
+	// Revoke disables the access token.
+	Revoke(ctx context.Context, token *oauth2.Token) error
+	// StartSession retrieves an authentication endpoint for the provider.
+	StartSession(state string) string
+	// Exchange authorizes the session and returns an access token.
+	Exchange(ctx context.Context, code string) (*oauth2.Token, error)
+	// Email retrieves the email address of the user.
+	Email(ctx context.Context, token *oauth2.Token) string
+	// Username retrieves the username of the user.
+	Username(ctx context.Context, token *oauth2.Token) string
+	// Refresh exchanges token's refresh token for a new access token,
+	// allowing a session to outlive the original grant's access token.
+	Refresh(ctx context.Context, token *oauth2.Token) (*oauth2.Token, error)
+}
+
+// CertStore is the persistence layer used to store sessions (certificates
+// and the OAuth tokens that back them) across requests, keyed by the
+// session/certificate id. It is what lets a refreshed token survive beyond
+// the process that minted it.
+type CertStore interface {
+	// Get returns the token stored for id.
+	Get(id string) (*oauth2.Token, error)
+	// Put persists token under id, overwriting any previous value.
+	Put(id string, token *oauth2.Token) error
+}
+
+// ServiceProvider is implemented by providers that support non-interactive
+// (machine) authentication - e.g. for CI runners and cron jobs - using
+// credentials such as a service-account key, instead of a browser-based
+// OAuth flow.
+type ServiceProvider interface {
+	// AuthenticateServiceAccount exchanges credentials for an access
+	// token, returning the token and the email address of the user it
+	// was issued for. The returned token is still subject to the
+	// provider's normal Valid checks (domain/whitelist/groups).
+	AuthenticateServiceAccount(ctx context.Context, credentials []byte) (*oauth2.Token, string, error)
+}
+
+// New creates a new Provider from the given configuration.
+func New(c *config.Auth) (Provider, error) {
+	switch c.Provider {
+	case "google":
+		return google.New(c)
+	case "github":
+		return github.New(c)
+	case "gitlab":
+		return gitlab.New(c)
+	case "bitbucket":
+		return bitbucket.New(c)
+	default:
+		return nil, fmt.Errorf("unknown provider %q", c.Provider)
+	}
+}
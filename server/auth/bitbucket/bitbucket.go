@@ -0,0 +1,201 @@
+package bitbucket
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/cashier-go/cashier/server/auth"
+	"github.com/cashier-go/cashier/server/config"
+	"github.com/cashier-go/cashier/server/metrics"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/bitbucket"
+)
+
+const (
+	name          = "bitbucket"
+	userURL       = "https://api.bitbucket.org/2.0/user"
+	emailsURL     = "https://api.bitbucket.org/2.0/user/emails"
+	workspacesURL = "https://api.bitbucket.org/2.0/user/permissions/workspaces"
+)
+
+// Config is an implementation of `auth.Provider` for authenticating using a
+// Bitbucket account.
+type Config struct {
+	config     *oauth2.Config
+	workspaces map[string]bool
+	whitelist  map[string]bool
+}
+
+var _ auth.Provider = (*Config)(nil)
+
+// New creates a new Bitbucket provider from a configuration.
+func New(c *config.Auth) (*Config, error) {
+	uw := make(map[string]bool)
+	for _, u := range c.UsersWhitelist {
+		uw[u] = true
+	}
+	ws := make(map[string]bool)
+	for _, w := range strings.Split(c.ProviderOpts["workspaces"], ",") {
+		if w = strings.TrimSpace(w); w != "" {
+			ws[w] = true
+		}
+	}
+	if len(ws) == 0 && len(uw) == 0 {
+		return nil, errors.New("either Bitbucket workspaces or users whitelist must be specified")
+	}
+
+	return &Config{
+		config: &oauth2.Config{
+			ClientID:     c.OauthClientID,
+			ClientSecret: c.OauthClientSecret,
+			RedirectURL:  c.OauthCallbackURL,
+			Endpoint:     bitbucket.Endpoint,
+		},
+		workspaces: ws,
+		whitelist:  uw,
+	}, nil
+}
+
+// A new oauth2 http client.
+func (c *Config) newClient(ctx context.Context, token *oauth2.Token) *http.Client {
+	return c.config.Client(ctx, token)
+}
+
+// Name returns the name of the provider.
+func (c *Config) Name() string {
+	return name
+}
+
+func get(ctx context.Context, client *http.Client, url string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, http.NoBody)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("bitbucket: unexpected status %s for %s", resp.Status, url)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+type bitbucketUser struct {
+	Username string `json:"username"`
+}
+
+type emailsResponse struct {
+	Values []struct {
+		Email       string `json:"email"`
+		IsPrimary   bool   `json:"is_primary"`
+		IsConfirmed bool   `json:"is_confirmed"`
+	} `json:"values"`
+}
+
+type workspacesResponse struct {
+	Next   string `json:"next"`
+	Values []struct {
+		Workspace struct {
+			Slug string `json:"slug"`
+		} `json:"workspace"`
+	} `json:"values"`
+}
+
+// inWorkspaces reports whether the user belongs to at least one of the
+// configured workspaces.
+func (c *Config) inWorkspaces(ctx context.Context, client *http.Client) bool {
+	url := workspacesURL
+	for url != "" {
+		var wr workspacesResponse
+		if err := get(ctx, client, url, &wr); err != nil {
+			return false
+		}
+		for _, v := range wr.Values {
+			if c.workspaces[v.Workspace.Slug] {
+				return true
+			}
+		}
+		url = wr.Next
+	}
+	return false
+}
+
+// Valid validates the oauth token.
+func (c *Config) Valid(ctx context.Context, token *oauth2.Token) bool {
+	if len(c.whitelist) > 0 && !c.whitelist[c.Email(ctx, token)] {
+		return false
+	}
+	// Deliberately not gated on token.Valid(): newClient's TokenSource
+	// transparently refreshes an expired access token using the refresh
+	// token, so an expired-but-refreshable token must still reach the
+	// checks below.
+	client := c.newClient(ctx, token)
+	if len(c.workspaces) > 0 && !c.inWorkspaces(ctx, client) {
+		return false
+	}
+	metrics.M.AuthValid.WithLabelValues("bitbucket").Inc()
+	return true
+}
+
+// Revoke is a no-op for Bitbucket, which has no token revocation endpoint.
+func (c *Config) Revoke(ctx context.Context, token *oauth2.Token) error {
+	return nil
+}
+
+// Refresh exchanges token's refresh token for a new access token.
+func (c *Config) Refresh(ctx context.Context, token *oauth2.Token) (*oauth2.Token, error) {
+	return c.config.TokenSource(ctx, token).Token()
+}
+
+// StartSession retrieves an authentication endpoint from Bitbucket.
+func (c *Config) StartSession(state string) string {
+	return c.config.AuthCodeURL(state)
+}
+
+// Exchange authorizes the session and returns an access token.
+func (c *Config) Exchange(ctx context.Context, code string) (*oauth2.Token, error) {
+	t, err := c.config.Exchange(ctx, code)
+	if err == nil {
+		metrics.M.AuthExchange.WithLabelValues("bitbucket").Inc()
+	}
+	return t, err
+}
+
+// Email retrieves the primary, verified email address of the user.
+func (c *Config) Email(ctx context.Context, token *oauth2.Token) string {
+	client := c.newClient(ctx, token)
+	var er emailsResponse
+	if err := get(ctx, client, emailsURL, &er); err != nil {
+		return ""
+	}
+	return primaryConfirmedEmail(er)
+}
+
+// primaryConfirmedEmail returns the user's primary email address, but only
+// if Bitbucket has it marked as confirmed. An unconfirmed primary email
+// must not be trusted for authentication.
+func primaryConfirmedEmail(er emailsResponse) string {
+	for _, v := range er.Values {
+		if v.IsPrimary && v.IsConfirmed {
+			return v.Email
+		}
+	}
+	return ""
+}
+
+// Username retrieves the username of the user.
+func (c *Config) Username(ctx context.Context, token *oauth2.Token) string {
+	client := c.newClient(ctx, token)
+	var u bitbucketUser
+	if err := get(ctx, client, userURL, &u); err != nil {
+		return ""
+	}
+	return u.Username
+}
@@ -0,0 +1,52 @@
+package bitbucket
+
+import "testing"
+
+func TestPrimaryConfirmedEmail(t *testing.T) {
+	tests := []struct {
+		name string
+		er   emailsResponse
+		want string
+	}{
+		{
+			name: "primary and confirmed",
+			er: emailsResponse{Values: []struct {
+				Email       string `json:"email"`
+				IsPrimary   bool   `json:"is_primary"`
+				IsConfirmed bool   `json:"is_confirmed"`
+			}{
+				{Email: "user@example.com", IsPrimary: true, IsConfirmed: true},
+			}},
+			want: "user@example.com",
+		},
+		{
+			name: "primary but unconfirmed is rejected",
+			er: emailsResponse{Values: []struct {
+				Email       string `json:"email"`
+				IsPrimary   bool   `json:"is_primary"`
+				IsConfirmed bool   `json:"is_confirmed"`
+			}{
+				{Email: "user@example.com", IsPrimary: true, IsConfirmed: false},
+			}},
+			want: "",
+		},
+		{
+			name: "confirmed but not primary is ignored",
+			er: emailsResponse{Values: []struct {
+				Email       string `json:"email"`
+				IsPrimary   bool   `json:"is_primary"`
+				IsConfirmed bool   `json:"is_confirmed"`
+			}{
+				{Email: "secondary@example.com", IsPrimary: false, IsConfirmed: true},
+			}},
+			want: "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := primaryConfirmedEmail(tt.er); got != tt.want {
+				t.Errorf("primaryConfirmedEmail() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
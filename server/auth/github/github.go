@@ -0,0 +1,181 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/cashier-go/cashier/server/auth"
+	"github.com/cashier-go/cashier/server/config"
+	"github.com/cashier-go/cashier/server/metrics"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/github"
+)
+
+const (
+	name      = "github"
+	userURL   = "https://api.github.com/user"
+	emailsURL = "https://api.github.com/user/emails"
+	orgsURL   = "https://api.github.com/user/orgs"
+)
+
+// Config is an implementation of `auth.Provider` for authenticating using a
+// GitHub account.
+type Config struct {
+	config       *oauth2.Config
+	whitelist    map[string]bool
+	organization string
+}
+
+var _ auth.Provider = (*Config)(nil)
+
+// New creates a new GitHub provider from a configuration.
+func New(c *config.Auth) (*Config, error) {
+	uw := make(map[string]bool)
+	for _, u := range c.UsersWhitelist {
+		uw[u] = true
+	}
+	org := c.ProviderOpts["organization"]
+	if org == "" && len(uw) == 0 {
+		return nil, errors.New("either a GitHub organization or users whitelist must be specified")
+	}
+
+	return &Config{
+		config: &oauth2.Config{
+			ClientID:     c.OauthClientID,
+			ClientSecret: c.OauthClientSecret,
+			RedirectURL:  c.OauthCallbackURL,
+			Endpoint:     github.Endpoint,
+			Scopes:       []string{"user:email", "read:org"},
+		},
+		whitelist:    uw,
+		organization: org,
+	}, nil
+}
+
+// A new oauth2 http client, backed by a TokenSource so an expired access
+// token is transparently refreshed.
+func (c *Config) newClient(ctx context.Context, token *oauth2.Token) *http.Client {
+	return oauth2.NewClient(ctx, c.config.TokenSource(ctx, token))
+}
+
+// Name returns the name of the provider.
+func (c *Config) Name() string {
+	return name
+}
+
+func get(ctx context.Context, client *http.Client, url string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, http.NoBody)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("github: unexpected status %s for %s", resp.Status, url)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+type githubUser struct {
+	Login string `json:"login"`
+}
+
+type emailEntry struct {
+	Email    string `json:"email"`
+	Primary  bool   `json:"primary"`
+	Verified bool   `json:"verified"`
+}
+
+type organization struct {
+	Login string `json:"login"`
+}
+
+// inOrganization reports whether the user belongs to the configured GitHub
+// organization.
+func (c *Config) inOrganization(ctx context.Context, client *http.Client) bool {
+	var orgs []organization
+	if err := get(ctx, client, orgsURL, &orgs); err != nil {
+		return false
+	}
+	for _, o := range orgs {
+		if strings.EqualFold(o.Login, c.organization) {
+			return true
+		}
+	}
+	return false
+}
+
+// Valid validates the oauth token.
+func (c *Config) Valid(ctx context.Context, token *oauth2.Token) bool {
+	email := c.Email(ctx, token)
+	if email == "" {
+		return false
+	}
+	if len(c.whitelist) > 0 && !c.whitelist[email] {
+		return false
+	}
+	client := c.newClient(ctx, token)
+	if c.organization != "" && !c.inOrganization(ctx, client) {
+		return false
+	}
+	metrics.M.AuthValid.WithLabelValues("github").Inc()
+	return true
+}
+
+// Revoke is a no-op; GitHub OAuth apps have no simple token-revocation
+// endpoint reachable with just the user's token.
+func (c *Config) Revoke(ctx context.Context, token *oauth2.Token) error {
+	return nil
+}
+
+// StartSession retrieves an authentication endpoint from GitHub.
+func (c *Config) StartSession(state string) string {
+	return c.config.AuthCodeURL(state)
+}
+
+// Exchange authorizes the session and returns an access token.
+func (c *Config) Exchange(ctx context.Context, code string) (*oauth2.Token, error) {
+	t, err := c.config.Exchange(ctx, code)
+	if err == nil {
+		metrics.M.AuthExchange.WithLabelValues("github").Inc()
+	}
+	return t, err
+}
+
+// Refresh exchanges token's refresh token for a new access token.
+func (c *Config) Refresh(ctx context.Context, token *oauth2.Token) (*oauth2.Token, error) {
+	return c.config.TokenSource(ctx, token).Token()
+}
+
+// Email retrieves the primary, verified email address of the user.
+func (c *Config) Email(ctx context.Context, token *oauth2.Token) string {
+	client := c.newClient(ctx, token)
+	var emails []emailEntry
+	if err := get(ctx, client, emailsURL, &emails); err != nil {
+		return ""
+	}
+	for _, e := range emails {
+		if e.Primary && e.Verified {
+			return e.Email
+		}
+	}
+	return ""
+}
+
+// Username retrieves the username of the user.
+func (c *Config) Username(ctx context.Context, token *oauth2.Token) string {
+	client := c.newClient(ctx, token)
+	var u githubUser
+	if err := get(ctx, client, userURL, &u); err != nil {
+		return ""
+	}
+	return u.Login
+}
@@ -0,0 +1,171 @@
+package gitlab
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/cashier-go/cashier/server/auth"
+	"github.com/cashier-go/cashier/server/config"
+	"github.com/cashier-go/cashier/server/metrics"
+
+	"golang.org/x/oauth2"
+)
+
+const (
+	name      = "gitlab"
+	authURL   = "https://gitlab.com/oauth/authorize"
+	tokenURL  = "https://gitlab.com/oauth/token"
+	userURL   = "https://gitlab.com/api/v4/user"
+	groupsURL = "https://gitlab.com/api/v4/groups?min_access_level=10"
+)
+
+// Config is an implementation of `auth.Provider` for authenticating using a
+// GitLab account.
+type Config struct {
+	config    *oauth2.Config
+	whitelist map[string]bool
+	group     string
+}
+
+var _ auth.Provider = (*Config)(nil)
+
+// New creates a new GitLab provider from a configuration.
+func New(c *config.Auth) (*Config, error) {
+	uw := make(map[string]bool)
+	for _, u := range c.UsersWhitelist {
+		uw[u] = true
+	}
+	group := c.ProviderOpts["group"]
+	if group == "" && len(uw) == 0 {
+		return nil, errors.New("either a GitLab group or users whitelist must be specified")
+	}
+
+	return &Config{
+		config: &oauth2.Config{
+			ClientID:     c.OauthClientID,
+			ClientSecret: c.OauthClientSecret,
+			RedirectURL:  c.OauthCallbackURL,
+			Endpoint:     oauth2.Endpoint{AuthURL: authURL, TokenURL: tokenURL},
+			Scopes:       []string{"read_user"},
+		},
+		whitelist: uw,
+		group:     group,
+	}, nil
+}
+
+// A new oauth2 http client, backed by a TokenSource so an expired access
+// token is transparently refreshed.
+func (c *Config) newClient(ctx context.Context, token *oauth2.Token) *http.Client {
+	return oauth2.NewClient(ctx, c.config.TokenSource(ctx, token))
+}
+
+// Name returns the name of the provider.
+func (c *Config) Name() string {
+	return name
+}
+
+func get(ctx context.Context, client *http.Client, url string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, http.NoBody)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("gitlab: unexpected status %s for %s", resp.Status, url)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+type gitlabUser struct {
+	Username string `json:"username"`
+	Email    string `json:"email"`
+}
+
+type group struct {
+	FullPath string `json:"full_path"`
+}
+
+// inGroup reports whether the user belongs to the configured GitLab group.
+func (c *Config) inGroup(ctx context.Context, client *http.Client) bool {
+	var groups []group
+	if err := get(ctx, client, groupsURL, &groups); err != nil {
+		return false
+	}
+	for _, g := range groups {
+		if strings.EqualFold(g.FullPath, c.group) {
+			return true
+		}
+	}
+	return false
+}
+
+// Valid validates the oauth token.
+func (c *Config) Valid(ctx context.Context, token *oauth2.Token) bool {
+	email := c.Email(ctx, token)
+	if email == "" {
+		return false
+	}
+	if len(c.whitelist) > 0 && !c.whitelist[email] {
+		return false
+	}
+	client := c.newClient(ctx, token)
+	if c.group != "" && !c.inGroup(ctx, client) {
+		return false
+	}
+	metrics.M.AuthValid.WithLabelValues("gitlab").Inc()
+	return true
+}
+
+// Revoke is a no-op; revoking would require the app's client secret to hit
+// GitLab's /oauth/revoke endpoint, which isn't worth the extra round trip
+// for this flow.
+func (c *Config) Revoke(ctx context.Context, token *oauth2.Token) error {
+	return nil
+}
+
+// StartSession retrieves an authentication endpoint from GitLab.
+func (c *Config) StartSession(state string) string {
+	return c.config.AuthCodeURL(state)
+}
+
+// Exchange authorizes the session and returns an access token.
+func (c *Config) Exchange(ctx context.Context, code string) (*oauth2.Token, error) {
+	t, err := c.config.Exchange(ctx, code)
+	if err == nil {
+		metrics.M.AuthExchange.WithLabelValues("gitlab").Inc()
+	}
+	return t, err
+}
+
+// Refresh exchanges token's refresh token for a new access token.
+func (c *Config) Refresh(ctx context.Context, token *oauth2.Token) (*oauth2.Token, error) {
+	return c.config.TokenSource(ctx, token).Token()
+}
+
+// Email retrieves the email address of the user.
+func (c *Config) Email(ctx context.Context, token *oauth2.Token) string {
+	client := c.newClient(ctx, token)
+	var u gitlabUser
+	if err := get(ctx, client, userURL, &u); err != nil {
+		return ""
+	}
+	return u.Email
+}
+
+// Username retrieves the username of the user.
+func (c *Config) Username(ctx context.Context, token *oauth2.Token) string {
+	client := c.newClient(ctx, token)
+	var u gitlabUser
+	if err := get(ctx, client, userURL, &u); err != nil {
+		return ""
+	}
+	return u.Username
+}
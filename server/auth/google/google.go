@@ -5,7 +5,10 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"os"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/cashier-go/cashier/server/auth"
 	"github.com/cashier-go/cashier/server/config"
@@ -13,6 +16,8 @@ import (
 
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/google"
+	admin "google.golang.org/api/admin/directory/v1"
+	"google.golang.org/api/idtoken"
 	googleapi "google.golang.org/api/oauth2/v2"
 	"google.golang.org/api/option"
 )
@@ -20,6 +25,11 @@ import (
 const (
 	revokeURL = "https://accounts.google.com/o/oauth2/revoke?token=%s"
 	name      = "google"
+
+	// groupCacheTTL bounds how long a group-membership lookup is trusted
+	// before we hit the Admin SDK again, keeping the extra API call off
+	// the hot path of every signed request.
+	groupCacheTTL = 5 * time.Minute
 )
 
 // Config is an implementation of `auth.Provider` for authenticating using a
@@ -28,9 +38,54 @@ type Config struct {
 	config    *oauth2.Config
 	domain    string
 	whitelist map[string]bool
+
+	groups            map[string]bool
+	serviceAccountKey []byte
+	impersonateUser   string
+	groupCache        *groupCache
+
+	// idTokenValidator verifies Google-signed id_tokens locally, caching
+	// the JWKS across calls instead of round-tripping to the tokeninfo
+	// and userinfo endpoints on every Valid call.
+	idTokenValidator *idtoken.Validator
+}
+
+// groupCache remembers recent group-membership decisions per email so that
+// Valid doesn't call the Admin SDK on every request.
+type groupCache struct {
+	mu      sync.Mutex
+	entries map[string]groupCacheEntry
+}
+
+type groupCacheEntry struct {
+	ok        bool
+	expiresAt time.Time
 }
 
-var _ auth.Provider = (*Config)(nil)
+func newGroupCache() *groupCache {
+	return &groupCache{entries: make(map[string]groupCacheEntry)}
+}
+
+func (c *groupCache) get(email string) (ok, found bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, found := c.entries[email]
+	if !found || time.Now().After(e.expiresAt) {
+		return false, false
+	}
+	return e.ok, true
+}
+
+func (c *groupCache) set(email string, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[email] = groupCacheEntry{ok: ok, expiresAt: time.Now().Add(groupCacheTTL)}
+}
+
+var (
+	_ auth.Provider        = (*Config)(nil)
+	_ auth.ServiceProvider = (*Config)(nil)
+)
 
 // New creates a new Google provider from a configuration.
 func New(c *config.Auth) (*Config, error) {
@@ -42,22 +97,54 @@ func New(c *config.Auth) (*Config, error) {
 		return nil, errors.New("either Google Apps domain or users whitelist must be specified")
 	}
 
+	groups := make(map[string]bool)
+	for _, g := range strings.Split(c.ProviderOpts["groups"], ",") {
+		if g = strings.TrimSpace(g); g != "" {
+			groups[g] = true
+		}
+	}
+	keyFile := c.ProviderOpts["service_account_key"]
+	impersonateUser := c.ProviderOpts["impersonate_user"]
+	var key []byte
+	if len(groups) > 0 {
+		if keyFile == "" || impersonateUser == "" {
+			return nil, errors.New("groups requires both service_account_key and impersonate_user")
+		}
+		var err error
+		key, err = os.ReadFile(keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read service account key: %v", err)
+		}
+	}
+
+	validator, err := idtoken.NewValidator(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("unable to create id_token validator: %v", err)
+	}
+
 	return &Config{
 		config: &oauth2.Config{
 			ClientID:     c.OauthClientID,
 			ClientSecret: c.OauthClientSecret,
 			RedirectURL:  c.OauthCallbackURL,
 			Endpoint:     google.Endpoint,
-			Scopes:       []string{googleapi.UserinfoEmailScope, googleapi.UserinfoProfileScope},
+			Scopes:       []string{googleapi.UserinfoEmailScope, googleapi.UserinfoProfileScope, "openid"},
 		},
-		domain:    c.ProviderOpts["domain"],
-		whitelist: uw,
+		domain:            c.ProviderOpts["domain"],
+		whitelist:         uw,
+		groups:            groups,
+		serviceAccountKey: key,
+		impersonateUser:   impersonateUser,
+		groupCache:        newGroupCache(),
+		idTokenValidator:  validator,
 	}, nil
 }
 
-// A new oauth2 http client.
+// A new oauth2 http client. The client is backed by c.config's TokenSource
+// so that an expired access token is transparently refreshed using the
+// token's refresh token, rather than requiring the user to re-authenticate.
 func (c *Config) newClient(ctx context.Context, token *oauth2.Token) *http.Client {
-	return c.config.Client(ctx, token)
+	return oauth2.NewClient(ctx, c.config.TokenSource(ctx, token))
 }
 
 // Name returns the name of the provider.
@@ -67,34 +154,126 @@ func (c *Config) Name() string {
 
 // Valid validates the oauth token.
 func (c *Config) Valid(ctx context.Context, token *oauth2.Token) bool {
-	if len(c.whitelist) > 0 && !c.whitelist[c.Email(ctx, token)] {
+	email := c.Email(ctx, token)
+	if len(c.whitelist) > 0 && !c.whitelist[email] {
 		return false
 	}
-	if !token.Valid() {
+	// Deliberately not gated on token.Valid(): that only checks the
+	// access token we were handed, before newClient's TokenSource gets a
+	// chance to refresh it. An expired-but-refreshable token must still
+	// reach the checks below, or a refresh token never actually extends
+	// the session.
+	if payload, ok := c.idTokenPayload(ctx, token); ok {
+		if c.domain != "" && claimString(payload, "hd") != c.domain {
+			return false
+		}
+	} else {
+		svc, err := googleapi.NewService(ctx, option.WithHTTPClient(c.newClient(ctx, token)))
+		if err != nil {
+			return false
+		}
+		t := svc.Tokeninfo()
+		t.AccessToken(token.AccessToken)
+		ti, err := t.Do()
+		if err != nil {
+			return false
+		}
+		if ti.Audience != c.config.ClientID {
+			return false
+		}
+		ui, err := svc.Userinfo.Get().Do()
+		if err != nil {
+			return false
+		}
+		if c.domain != "" && ui.Hd != c.domain {
+			return false
+		}
+	}
+	if len(c.groups) > 0 && !c.inGroups(ctx, email) {
+		metrics.M.GroupCheck.WithLabelValues("fail").Inc()
 		return false
 	}
-	svc, err := googleapi.NewService(ctx, option.WithHTTPClient(c.newClient(ctx, token)))
+	if len(c.groups) > 0 {
+		metrics.M.GroupCheck.WithLabelValues("pass").Inc()
+	}
+	metrics.M.AuthValid.WithLabelValues("google").Inc()
+	return true
+}
+
+// idTokenPayload verifies and returns the claims of the id_token attached to
+// token, if any. The signature is checked locally against Google's cached
+// JWKS rather than by calling the tokeninfo endpoint.
+func (c *Config) idTokenPayload(ctx context.Context, token *oauth2.Token) (*idtoken.Payload, bool) {
+	raw, ok := token.Extra("id_token").(string)
+	if !ok || raw == "" {
+		return nil, false
+	}
+	payload, err := c.idTokenValidator.Validate(ctx, raw, c.config.ClientID)
 	if err != nil {
+		return nil, false
+	}
+	iss := claimString(payload, "iss")
+	if iss != "accounts.google.com" && iss != "https://accounts.google.com" {
+		return nil, false
+	}
+	// A signed id_token can still carry an email Google itself hasn't
+	// verified (e.g. for some third-party-managed accounts); don't treat
+	// it as authoritative for whitelist/domain decisions unless it is.
+	if !claimBool(payload, "email_verified") {
+		return nil, false
+	}
+	return payload, true
+}
+
+func claimString(payload *idtoken.Payload, key string) string {
+	s, _ := payload.Claims[key].(string)
+	return s
+}
+
+func claimBool(payload *idtoken.Payload, key string) bool {
+	switch v := payload.Claims[key].(type) {
+	case bool:
+		return v
+	case string:
+		return v == "true"
+	default:
 		return false
 	}
-	t := svc.Tokeninfo()
-	t.AccessToken(token.AccessToken)
-	ti, err := t.Do()
+}
+
+// inGroups reports whether email is a member of at least one of the
+// configured Google Workspace groups, consulting the Admin SDK Directory
+// API through a domain-wide-delegated service account.
+func (c *Config) inGroups(ctx context.Context, email string) bool {
+	if ok, found := c.groupCache.get(email); found {
+		return ok
+	}
+	ok := c.lookupGroups(ctx, email)
+	c.groupCache.set(email, ok)
+	return ok
+}
+
+func (c *Config) lookupGroups(ctx context.Context, email string) bool {
+	jwtConfig, err := google.JWTConfigFromJSON(c.serviceAccountKey, admin.AdminDirectoryGroupReadonlyScope)
 	if err != nil {
 		return false
 	}
-	if ti.Audience != c.config.ClientID {
+	jwtConfig.Subject = c.impersonateUser
+
+	svc, err := admin.NewService(ctx, option.WithHTTPClient(jwtConfig.Client(ctx)))
+	if err != nil {
 		return false
 	}
-	ui, err := svc.Userinfo.Get().Do()
+	resp, err := svc.Groups.List().UserKey(email).Do()
 	if err != nil {
 		return false
 	}
-	if c.domain != "" && ui.Hd != c.domain {
-		return false
+	for _, g := range resp.Groups {
+		if c.groups[g.Email] {
+			return true
+		}
 	}
-	metrics.M.AuthValid.WithLabelValues("google").Inc()
-	return true
+	return false
 }
 
 // Revoke disables the access token.
@@ -113,9 +292,16 @@ func (c *Config) Revoke(ctx context.Context, token *oauth2.Token) error {
 	return nil
 }
 
-// StartSession retrieves an authentication endpoint from Google.
+// StartSession retrieves an authentication endpoint from Google. It
+// requests offline access and forces the consent prompt so that Google
+// returns a refresh token even on repeat logins, letting the session
+// outlive the short-lived access token.
 func (c *Config) StartSession(state string) string {
-	return c.config.AuthCodeURL(state, oauth2.SetAuthURLParam("hd", c.domain))
+	return c.config.AuthCodeURL(state,
+		oauth2.SetAuthURLParam("hd", c.domain),
+		oauth2.AccessTypeOffline,
+		oauth2.SetAuthURLParam("prompt", "consent"),
+	)
 }
 
 // Exchange authorizes the session and returns an access token.
@@ -127,8 +313,47 @@ func (c *Config) Exchange(ctx context.Context, code string) (*oauth2.Token, erro
 	return t, err
 }
 
-// Email retrieves the email address of the user.
+// AuthenticateServiceAccount implements `auth.ServiceProvider`, letting
+// non-interactive callers (CI runners, cron jobs) authenticate with a
+// Google service-account key instead of a browser flow. credentials is the
+// JSON key downloaded for the service account; it is used, via domain-wide
+// delegation, to mint a token for the provider's configured impersonateUser.
+// The resolved token and email are still subject to the usual
+// domain/whitelist/groups checks in Valid.
+func (c *Config) AuthenticateServiceAccount(ctx context.Context, credentials []byte) (*oauth2.Token, string, error) {
+	if c.impersonateUser == "" {
+		return nil, "", errors.New("impersonate_user must be configured for service account authentication")
+	}
+	jwtConfig, err := google.JWTConfigFromJSON(credentials, googleapi.UserinfoEmailScope)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid service account credentials: %v", err)
+	}
+	jwtConfig.Subject = c.impersonateUser
+
+	token, err := jwtConfig.TokenSource(ctx).Token()
+	if err != nil {
+		return nil, "", fmt.Errorf("unable to mint token for %s: %v", c.impersonateUser, err)
+	}
+	return token, c.impersonateUser, nil
+}
+
+// Refresh exchanges token's refresh token for a new access token. It
+// implements `auth.Provider`'s Refresh method so that the HTTP handler can
+// persist the rotated token back to the session/CertStore layer.
+func (c *Config) Refresh(ctx context.Context, token *oauth2.Token) (*oauth2.Token, error) {
+	return c.config.TokenSource(ctx, token).Token()
+}
+
+// Email retrieves the email address of the user. When the token carries a
+// verified id_token, the email is read from its claims; otherwise it falls
+// back to calling the Userinfo endpoint (e.g. for refreshed tokens that
+// lack the openid scope).
 func (c *Config) Email(ctx context.Context, token *oauth2.Token) string {
+	if payload, ok := c.idTokenPayload(ctx, token); ok {
+		if email := claimString(payload, "email"); email != "" {
+			return email
+		}
+	}
 	svc, err := googleapi.NewService(ctx, option.WithHTTPClient(c.newClient(ctx, token)))
 	if err != nil {
 		return ""
@@ -0,0 +1,77 @@
+package google
+
+import (
+	"testing"
+	"time"
+
+	"google.golang.org/api/idtoken"
+)
+
+func TestGroupCacheExpiry(t *testing.T) {
+	c := newGroupCache()
+
+	if _, found := c.get("user@example.com"); found {
+		t.Fatal("get() on empty cache: want not found")
+	}
+
+	c.set("user@example.com", true)
+	ok, found := c.get("user@example.com")
+	if !found || !ok {
+		t.Fatalf("get() after set(true) = %v, %v, want true, true", ok, found)
+	}
+
+	// Force the entry to look expired and confirm it's no longer served.
+	c.mu.Lock()
+	c.entries["user@example.com"] = groupCacheEntry{ok: true, expiresAt: time.Now().Add(-time.Second)}
+	c.mu.Unlock()
+
+	if _, found := c.get("user@example.com"); found {
+		t.Fatal("get() on expired entry: want not found")
+	}
+}
+
+func TestClaimString(t *testing.T) {
+	payload := &idtoken.Payload{Claims: map[string]interface{}{
+		"email": "user@example.com",
+		"hd":    "example.com",
+		"aud":   42, // a non-string claim should be ignored, not panic
+	}}
+
+	if got := claimString(payload, "email"); got != "user@example.com" {
+		t.Errorf("claimString(email) = %q, want %q", got, "user@example.com")
+	}
+	if got := claimString(payload, "hd"); got != "example.com" {
+		t.Errorf("claimString(hd) = %q, want %q", got, "example.com")
+	}
+	if got := claimString(payload, "aud"); got != "" {
+		t.Errorf("claimString(aud) = %q, want empty string for non-string claim", got)
+	}
+	if got := claimString(payload, "missing"); got != "" {
+		t.Errorf("claimString(missing) = %q, want empty string", got)
+	}
+}
+
+func TestClaimBool(t *testing.T) {
+	payload := &idtoken.Payload{Claims: map[string]interface{}{
+		"bool_true":    true,
+		"bool_false":   false,
+		"string_true":  "true",
+		"string_other": "yes",
+	}}
+
+	tests := []struct {
+		key  string
+		want bool
+	}{
+		{"bool_true", true},
+		{"bool_false", false},
+		{"string_true", true},
+		{"string_other", false},
+		{"missing", false},
+	}
+	for _, tt := range tests {
+		if got := claimBool(payload, tt.key); got != tt.want {
+			t.Errorf("claimBool(%q) = %v, want %v", tt.key, got, tt.want)
+		}
+	}
+}
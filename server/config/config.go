@@ -0,0 +1,23 @@
+// Package config holds the configuration types shared by the server and
+// its authentication providers.
+package config
+
+// Auth holds the configuration for an authentication provider, as loaded
+// from the server's config file.
+type Auth struct {
+	// Provider selects which authentication backend to use, e.g.
+	// "google", "github", "gitlab", "bitbucket".
+	Provider string
+
+	OauthClientID     string
+	OauthClientSecret string
+	OauthCallbackURL  string
+
+	// UsersWhitelist, when non-empty, restricts authentication to these
+	// email addresses; the provider's domain/group checks still apply.
+	UsersWhitelist []string
+
+	// ProviderOpts holds provider-specific options, e.g. "domain",
+	// "groups", "workspaces", "service_account_key".
+	ProviderOpts map[string]string
+}
@@ -0,0 +1,36 @@
+// Package metrics exposes the Prometheus counters shared by the server's
+// authentication providers.
+package metrics
+
+import "github.com/prometheus/client_golang/prometheus"
+
+// M holds the process-wide metric collectors. Providers increment these
+// directly rather than each declaring their own.
+var M = struct {
+	// AuthValid counts successful token validations, labelled by provider
+	// name (e.g. "google", "bitbucket").
+	AuthValid *prometheus.CounterVec
+	// AuthExchange counts successful OAuth2 code exchanges, labelled by
+	// provider name.
+	AuthExchange *prometheus.CounterVec
+	// GroupCheck counts Workspace group-membership checks, labelled
+	// "pass" or "fail".
+	GroupCheck *prometheus.CounterVec
+}{
+	AuthValid: prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "cashier_auth_valid_total",
+		Help: "Number of successful token validations, by provider.",
+	}, []string{"provider"}),
+	AuthExchange: prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "cashier_auth_exchange_total",
+		Help: "Number of successful OAuth2 code exchanges, by provider.",
+	}, []string{"provider"}),
+	GroupCheck: prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "cashier_auth_group_check_total",
+		Help: "Number of Workspace group-membership checks, by result (pass/fail).",
+	}, []string{"result"}),
+}
+
+func init() {
+	prometheus.MustRegister(M.AuthValid, M.AuthExchange, M.GroupCheck)
+}
@@ -0,0 +1,148 @@
+// Package server ties the configured auth provider to the certificate
+// store, persisting sessions across the token refreshes that keep them
+// alive.
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/cashier-go/cashier/server/auth"
+	"github.com/cashier-go/cashier/server/signer"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/oauth2"
+)
+
+// Server handles the OAuth2 callback and session-refresh flow for a single
+// configured provider.
+type Server struct {
+	Provider auth.Provider
+	Store    auth.CertStore
+	Signer   *signer.Signer
+
+	// BootstrapToken gates the /auth/sa service-account endpoint. It
+	// must be configured (e.g. via config.Auth.ProviderOpts) for that
+	// endpoint to accept requests; it is meant to sit behind mTLS or
+	// another authenticated channel, not to be the sole protection.
+	BootstrapToken string
+}
+
+// Exchange completes the OAuth2 flow for code and persists the resulting
+// token - including its refresh token, when the provider requested offline
+// access - under id, so the session can later be renewed without another
+// browser round-trip.
+func (s *Server) Exchange(ctx context.Context, id, code string) (*oauth2.Token, error) {
+	token, err := s.Provider.Exchange(ctx, code)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.Store.Put(id, token); err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+// RefreshSession refreshes the token stored under id and writes the
+// rotated token back to the store whenever the provider's TokenSource
+// issues a new one, so long-lived sessions stay valid without the caller
+// re-authenticating in a browser.
+func (s *Server) RefreshSession(ctx context.Context, id string) (*oauth2.Token, error) {
+	token, err := s.Store.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	refreshed, err := s.Provider.Refresh(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	if refreshed.AccessToken != token.AccessToken {
+		if err := s.Store.Put(id, refreshed); err != nil {
+			return nil, err
+		}
+	}
+	return refreshed, nil
+}
+
+// AuthenticateServiceAccount authenticates a non-interactive caller (CI,
+// cron) using a service-account key, gated by the pre-shared bootstrap
+// token, persists the resulting session the same way an interactive login
+// would, and mints a certificate authorizing pubKey to log in as the
+// resolved identity. It returns an error if the provider doesn't support
+// service-account authentication, the bootstrap token doesn't match, or
+// the resolved identity fails the provider's domain/whitelist/groups
+// checks.
+func (s *Server) AuthenticateServiceAccount(ctx context.Context, id, bootstrapToken string, credentials []byte, pubKey ssh.PublicKey) (*ssh.Certificate, error) {
+	if s.BootstrapToken == "" || subtle.ConstantTimeCompare([]byte(bootstrapToken), []byte(s.BootstrapToken)) != 1 {
+		return nil, errors.New("invalid bootstrap token")
+	}
+	sp, ok := s.Provider.(auth.ServiceProvider)
+	if !ok {
+		return nil, errors.New("provider does not support service account authentication")
+	}
+	token, email, err := sp.AuthenticateServiceAccount(ctx, credentials)
+	if err != nil {
+		return nil, err
+	}
+	if !s.Provider.Valid(ctx, token) {
+		return nil, errors.New("service account identity is not authorized")
+	}
+	if err := s.Store.Put(id, token); err != nil {
+		return nil, err
+	}
+	return s.Signer.Sign(email, pubKey)
+}
+
+// serviceAccountRequest is the body accepted by the /auth/sa endpoint.
+type serviceAccountRequest struct {
+	ID          string `json:"id"`
+	Credentials []byte `json:"credentials"`
+	// PublicKey is the SSH public key to certify, in authorized_keys
+	// format.
+	PublicKey string `json:"public_key"`
+}
+
+// ServeSA handles POST /auth/sa: a headless login using a service-account
+// key, authenticated by the X-Cashier-Bootstrap-Token header (expected to
+// be presented over mTLS or another already-authenticated channel). On
+// success it returns the signed certificate, in authorized_keys format, for
+// the caller's public key.
+func (s *Server) ServeSA(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		http.Error(w, "unable to read request body", http.StatusBadRequest)
+		return
+	}
+	var req serviceAccountRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	pubKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(req.PublicKey))
+	if err != nil {
+		http.Error(w, "invalid public key", http.StatusBadRequest)
+		return
+	}
+	cert, err := s.AuthenticateServiceAccount(r.Context(), req.ID, r.Header.Get("X-Cashier-Bootstrap-Token"), req.Credentials, pubKey)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]string{
+		"certificate": string(ssh.MarshalAuthorizedKey(cert)),
+	})
+}
+
+// RegisterRoutes wires the server's HTTP endpoints onto mux.
+func (s *Server) RegisterRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("/auth/sa", s.ServeSA)
+}
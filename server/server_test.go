@@ -0,0 +1,210 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/cashier-go/cashier/server/signer"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/oauth2"
+)
+
+type fakeProvider struct {
+	refreshed *oauth2.Token
+}
+
+func (p *fakeProvider) Name() string                                          { return "fake" }
+func (p *fakeProvider) Valid(ctx context.Context, token *oauth2.Token) bool   { return true }
+func (p *fakeProvider) Revoke(ctx context.Context, token *oauth2.Token) error { return nil }
+func (p *fakeProvider) StartSession(state string) string                      { return "" }
+func (p *fakeProvider) Email(ctx context.Context, token *oauth2.Token) string { return "" }
+func (p *fakeProvider) Username(ctx context.Context, token *oauth2.Token) string {
+	return ""
+}
+func (p *fakeProvider) Exchange(ctx context.Context, code string) (*oauth2.Token, error) {
+	return &oauth2.Token{AccessToken: "exchanged"}, nil
+}
+func (p *fakeProvider) Refresh(ctx context.Context, token *oauth2.Token) (*oauth2.Token, error) {
+	return p.refreshed, nil
+}
+
+// fakeServiceProvider additionally implements auth.ServiceProvider.
+type fakeServiceProvider struct {
+	fakeProvider
+	valid bool
+}
+
+func (p *fakeServiceProvider) Valid(ctx context.Context, token *oauth2.Token) bool { return p.valid }
+
+func (p *fakeServiceProvider) AuthenticateServiceAccount(ctx context.Context, credentials []byte) (*oauth2.Token, string, error) {
+	return &oauth2.Token{AccessToken: "sa-token"}, "ci@example.com", nil
+}
+
+type fakeStore struct {
+	tokens map[string]*oauth2.Token
+}
+
+func newFakeStore() *fakeStore {
+	return &fakeStore{tokens: make(map[string]*oauth2.Token)}
+}
+
+func (s *fakeStore) Get(id string) (*oauth2.Token, error) {
+	t, ok := s.tokens[id]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	return t, nil
+}
+
+func (s *fakeStore) Put(id string, token *oauth2.Token) error {
+	s.tokens[id] = token
+	return nil
+}
+
+// testSigner returns a signer.Signer backed by a freshly generated CA key,
+// along with an unrelated public key for the caller to request a
+// certificate for.
+func testSigner(t *testing.T) (*signer.Signer, ssh.PublicKey) {
+	t.Helper()
+	caKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("unable to generate CA key: %v", err)
+	}
+	caPEM := pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(caKey),
+	})
+	s, err := signer.New(caPEM, time.Hour)
+	if err != nil {
+		t.Fatalf("signer.New() error = %v", err)
+	}
+
+	userKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("unable to generate user key: %v", err)
+	}
+	pubKey, err := ssh.NewPublicKey(&userKey.PublicKey)
+	if err != nil {
+		t.Fatalf("unable to build user public key: %v", err)
+	}
+	return s, pubKey
+}
+
+func TestExchangePersistsToken(t *testing.T) {
+	store := newFakeStore()
+	srv := &Server{Provider: &fakeProvider{}, Store: store}
+
+	if _, err := srv.Exchange(context.Background(), "session1", "code"); err != nil {
+		t.Fatalf("Exchange() error = %v", err)
+	}
+	got, err := store.Get("session1")
+	if err != nil {
+		t.Fatalf("store.Get() error = %v", err)
+	}
+	if got.AccessToken != "exchanged" {
+		t.Errorf("stored token = %q, want %q", got.AccessToken, "exchanged")
+	}
+}
+
+func TestRefreshSessionPersistsRotatedToken(t *testing.T) {
+	store := newFakeStore()
+	store.tokens["session1"] = &oauth2.Token{AccessToken: "old"}
+	srv := &Server{
+		Provider: &fakeProvider{refreshed: &oauth2.Token{AccessToken: "new"}},
+		Store:    store,
+	}
+
+	if _, err := srv.RefreshSession(context.Background(), "session1"); err != nil {
+		t.Fatalf("RefreshSession() error = %v", err)
+	}
+	got, _ := store.Get("session1")
+	if got.AccessToken != "new" {
+		t.Errorf("stored token = %q, want %q", got.AccessToken, "new")
+	}
+}
+
+func TestRefreshSessionSkipsWriteWhenUnrotated(t *testing.T) {
+	store := newFakeStore()
+	orig := &oauth2.Token{AccessToken: "same"}
+	store.tokens["session1"] = orig
+	srv := &Server{
+		Provider: &fakeProvider{refreshed: &oauth2.Token{AccessToken: "same"}},
+		Store:    store,
+	}
+
+	if _, err := srv.RefreshSession(context.Background(), "session1"); err != nil {
+		t.Fatalf("RefreshSession() error = %v", err)
+	}
+	got, _ := store.Get("session1")
+	if got != orig {
+		t.Errorf("stored token was overwritten with %v, want the original token left in place", got)
+	}
+}
+
+func TestAuthenticateServiceAccountRejectsBadBootstrapToken(t *testing.T) {
+	s, pubKey := testSigner(t)
+	srv := &Server{
+		Provider:       &fakeServiceProvider{valid: true},
+		Store:          newFakeStore(),
+		Signer:         s,
+		BootstrapToken: "correct-token",
+	}
+	if _, err := srv.AuthenticateServiceAccount(context.Background(), "sess", "wrong-token", []byte("{}"), pubKey); err == nil {
+		t.Fatal("AuthenticateServiceAccount() with wrong bootstrap token: want error, got nil")
+	}
+}
+
+func TestAuthenticateServiceAccountRejectsUnauthorizedIdentity(t *testing.T) {
+	s, pubKey := testSigner(t)
+	srv := &Server{
+		Provider:       &fakeServiceProvider{valid: false},
+		Store:          newFakeStore(),
+		Signer:         s,
+		BootstrapToken: "correct-token",
+	}
+	if _, err := srv.AuthenticateServiceAccount(context.Background(), "sess", "correct-token", []byte("{}"), pubKey); err == nil {
+		t.Fatal("AuthenticateServiceAccount() with unauthorized identity: want error, got nil")
+	}
+}
+
+func TestAuthenticateServiceAccountPersistsToken(t *testing.T) {
+	store := newFakeStore()
+	s, pubKey := testSigner(t)
+	srv := &Server{
+		Provider:       &fakeServiceProvider{valid: true},
+		Store:          store,
+		Signer:         s,
+		BootstrapToken: "correct-token",
+	}
+	cert, err := srv.AuthenticateServiceAccount(context.Background(), "sess", "correct-token", []byte("{}"), pubKey)
+	if err != nil {
+		t.Fatalf("AuthenticateServiceAccount() error = %v", err)
+	}
+	if cert.KeyId != "ci@example.com" {
+		t.Errorf("cert.KeyId = %q, want %q", cert.KeyId, "ci@example.com")
+	}
+	got, err := store.Get("sess")
+	if err != nil || got.AccessToken != "sa-token" {
+		t.Errorf("store.Get(%q) = %v, %v, want %q persisted", "sess", got, err, "sa-token")
+	}
+}
+
+func TestAuthenticateServiceAccountRequiresServiceProvider(t *testing.T) {
+	s, pubKey := testSigner(t)
+	srv := &Server{
+		Provider:       &fakeProvider{},
+		Store:          newFakeStore(),
+		Signer:         s,
+		BootstrapToken: "correct-token",
+	}
+	if _, err := srv.AuthenticateServiceAccount(context.Background(), "sess", "correct-token", []byte("{}"), pubKey); err == nil {
+		t.Fatal("AuthenticateServiceAccount() with non-ServiceProvider: want error, got nil")
+	}
+}
@@ -0,0 +1,44 @@
+// Package signer issues short-lived SSH user certificates signed by the
+// server's CA key.
+package signer
+
+import (
+	"crypto/rand"
+	"fmt"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Signer mints SSH user certificates.
+type Signer struct {
+	ca  ssh.Signer
+	ttl time.Duration
+}
+
+// New creates a Signer from a PEM-encoded CA private key. Certificates it
+// issues are valid for ttl.
+func New(caKey []byte, ttl time.Duration) (*Signer, error) {
+	ca, err := ssh.ParsePrivateKey(caKey)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse CA key: %v", err)
+	}
+	return &Signer{ca: ca, ttl: ttl}, nil
+}
+
+// Sign issues a user certificate authorizing pubKey to log in as principal.
+func (s *Signer) Sign(principal string, pubKey ssh.PublicKey) (*ssh.Certificate, error) {
+	now := time.Now()
+	cert := &ssh.Certificate{
+		Key:             pubKey,
+		CertType:        ssh.UserCert,
+		KeyId:           principal,
+		ValidPrincipals: []string{principal},
+		ValidAfter:      uint64(now.Unix()),
+		ValidBefore:     uint64(now.Add(s.ttl).Unix()),
+	}
+	if err := cert.SignCert(rand.Reader, s.ca); err != nil {
+		return nil, fmt.Errorf("unable to sign certificate: %v", err)
+	}
+	return cert, nil
+}